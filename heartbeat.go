@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"time"
+)
+
+// heartbeater periodically writes this process's identity and worker
+// statuses to the store, so every task-server instance sharing a backend
+// can be enumerated and monitored.
+type heartbeater struct {
+	store       Store
+	serverID    string
+	host        string
+	pid         int
+	concurrency int
+	startedAt   time.Time
+	interval    time.Duration
+}
+
+// newHeartbeater builds a heartbeater identifying this process, generating
+// a random server ID to disambiguate it from other instances sharing host
+// and backend.
+func newHeartbeater(store Store, concurrency int, interval time.Duration) *heartbeater {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &heartbeater{
+		store:       store,
+		serverID:    newServerID(),
+		host:        host,
+		pid:         os.Getpid(),
+		concurrency: concurrency,
+		startedAt:   time.Now(),
+		interval:    interval,
+	}
+}
+
+func newServerID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// run writes a heartbeat immediately, then every interval, until done is
+// closed. workerStatus is called on each tick to capture the current
+// worker statuses to report.
+func (h *heartbeater) run(done <-chan struct{}, workerStatus func() []WorkerStatus) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	h.beat(workerStatus())
+	for {
+		select {
+		case <-ticker.C:
+			h.beat(workerStatus())
+		case <-done:
+			return
+		}
+	}
+}
+
+func (h *heartbeater) beat(workers []WorkerStatus) {
+	info := ProcessInfo{
+		Host:        h.host,
+		PID:         h.pid,
+		ServerID:    h.serverID,
+		Concurrency: h.concurrency,
+		StartedAt:   h.startedAt,
+		Workers:     workers,
+		UpdatedAt:   time.Now(),
+	}
+	if err := h.store.SaveHeartbeat(info); err != nil {
+		log.Printf("heartbeat: failed to write process info: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunMetrics captures the resource cost of a single task execution.
+type RunMetrics struct {
+	WallTimeMs  int64  `json:"wall_time_ms"`
+	CPUTimeMs   int64  `json:"cpu_time_ms"`
+	MaxRSSBytes int64  `json:"max_rss_bytes"`
+	ExitStatus  string `json:"exit_status"`
+}
+
+// Exit statuses recorded in RunMetrics. ExitStatusMemoryLimit is reserved
+// for when a task actually runs in its own subprocess/cgroup and its memory
+// use can be isolated and enforced; see runWithLimits.
+const (
+	ExitStatusOK          = "ok"
+	ExitStatusFailed      = "failed"
+	ExitStatusTimeLimit   = "time_limit_exceeded"
+	ExitStatusMemoryLimit = "memory_limit_exceeded"
+)
+
+// maxMetricsPerTask bounds how many RunMetrics entries a Store keeps per
+// task; older entries are dropped as new ones arrive.
+const maxMetricsPerTask = 20
+
+// resourceUsage reports cumulative CPU time and current max RSS for this
+// process. It is implemented per-OS: cgroup-based on Linux (see
+// metrics_linux.go), RUSAGE_CHILDREN elsewhere (see metrics_other.go).
+
+// runWithLimits runs fn and returns its result alongside RunMetrics. If
+// task.TimeLimitMs is set and fn doesn't return in time, the call is
+// abandoned (Go has no safe way to kill a running goroutine, so the
+// underlying work keeps running in the background) and ExitStatus is set to
+// time_limit_exceeded.
+//
+// MaxRSSBytes is resourceUsage's process-wide reading (or RUSAGE_CHILDREN,
+// which is ~0 since fn runs in-process rather than as a subprocess) — it
+// isn't attributable to this one task, so task.MemoryLimitMB is recorded
+// alongside it for visibility but never compared against it here. Enforcing
+// MemoryLimitMB needs fn to run in its own subprocess/cgroup so its memory
+// use can actually be isolated and measured.
+func runWithLimits(task Task, fn func() (interface{}, error)) (interface{}, error, RunMetrics) {
+	type outcome struct {
+		value interface{}
+		err   error
+	}
+
+	start := time.Now()
+	startCPU, _, _ := resourceUsage()
+
+	resultCh := make(chan outcome, 1)
+	go func() {
+		value, err := fn()
+		resultCh <- outcome{value: value, err: err}
+	}()
+
+	var out outcome
+	timedOut := false
+	if task.TimeLimitMs > 0 {
+		select {
+		case out = <-resultCh:
+		case <-time.After(time.Duration(task.TimeLimitMs) * time.Millisecond):
+			timedOut = true
+			out.err = fmt.Errorf("task %d: exceeded time limit of %dms", task.ID, task.TimeLimitMs)
+		}
+	} else {
+		out = <-resultCh
+	}
+
+	metrics := RunMetrics{
+		WallTimeMs: time.Since(start).Milliseconds(),
+		ExitStatus: ExitStatusOK,
+	}
+	if cpu, rss, err := resourceUsage(); err == nil {
+		metrics.CPUTimeMs = cpu - startCPU
+		metrics.MaxRSSBytes = rss
+	}
+
+	switch {
+	case timedOut:
+		metrics.ExitStatus = ExitStatusTimeLimit
+	case out.err != nil:
+		metrics.ExitStatus = ExitStatusFailed
+	}
+
+	return out.value, out.err, metrics
+}
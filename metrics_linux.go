@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resourceUsage reads CPU and memory usage from this process's cgroup,
+// supporting both the cgroup v2 unified hierarchy and cgroup v1, and falls
+// back to RUSAGE_CHILDREN if neither is available (e.g. not running inside
+// a container).
+func resourceUsage() (cpuTimeMs int64, maxRSSBytes int64, err error) {
+	if ms, rss, ok := cgroupV2Usage(); ok {
+		return ms, rss, nil
+	}
+	if ms, rss, ok := cgroupV1Usage(); ok {
+		return ms, rss, nil
+	}
+	return rusageChildrenUsage()
+}
+
+// cgroupPath returns this process's cgroup path as reported in
+// /proc/self/cgroup.
+func cgroupPath() (string, bool) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) == 3 {
+			return parts[2], true
+		}
+	}
+	return "", false
+}
+
+func cgroupV2Usage() (cpuTimeMs int64, maxRSSBytes int64, ok bool) {
+	path, found := cgroupPath()
+	if !found {
+		return 0, 0, false
+	}
+	base := "/sys/fs/cgroup" + path
+
+	usec, err := readKeyedStat(base+"/cpu.stat", "usage_usec")
+	if err != nil {
+		return 0, 0, false
+	}
+	mem, _ := readIntFile(base + "/memory.current")
+	return usec / 1000, mem, true
+}
+
+func cgroupV1Usage() (cpuTimeMs int64, maxRSSBytes int64, ok bool) {
+	path, found := cgroupPath()
+	if !found {
+		return 0, 0, false
+	}
+
+	ns, err := readIntFile("/sys/fs/cgroup/cpu,cpuacct" + path + "/cpuacct.usage")
+	if err != nil {
+		return 0, 0, false
+	}
+	mem, _ := readIntFile("/sys/fs/cgroup/memory" + path + "/memory.max_usage_in_bytes")
+	return ns / 1e6, mem, true
+}
+
+func readIntFile(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func readKeyedStat(path, key string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("key %q not found in %s", key, path)
+}
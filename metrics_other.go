@@ -0,0 +1,10 @@
+//go:build !linux && unix
+
+package main
+
+// resourceUsage reports CPU time and max RSS via RUSAGE_CHILDREN; cgroups
+// are a Linux-only concept, so non-Linux platforms skip straight to the
+// fallback (see metrics_linux.go for the Linux cgroup-aware version).
+func resourceUsage() (cpuTimeMs int64, maxRSSBytes int64, err error) {
+	return rusageChildrenUsage()
+}
@@ -0,0 +1,20 @@
+//go:build unix && !linux
+
+package main
+
+import "syscall"
+
+// rusageChildrenUsage reports cumulative CPU time and max RSS for this
+// process's terminated children, used when cgroup stats aren't available.
+// ru.Maxrss is already in bytes on these platforms (unlike Linux; see
+// metrics_rusage_linux.go).
+func rusageChildrenUsage() (cpuTimeMs int64, maxRSSBytes int64, err error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &ru); err != nil {
+		return 0, 0, err
+	}
+	cpuTimeMs = int64(ru.Utime.Sec)*1000 + int64(ru.Utime.Usec)/1000 +
+		int64(ru.Stime.Sec)*1000 + int64(ru.Stime.Usec)/1000
+	maxRSSBytes = int64(ru.Maxrss)
+	return cpuTimeMs, maxRSSBytes, nil
+}
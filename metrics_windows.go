@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "fmt"
+
+// resourceUsage has no RUSAGE_CHILDREN or cgroup equivalent on Windows, so
+// wall time (always gathered separately) is all runWithLimits can report.
+func resourceUsage() (cpuTimeMs int64, maxRSSBytes int64, err error) {
+	return 0, 0, fmt.Errorf("resourceUsage: not supported on windows")
+}
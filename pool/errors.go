@@ -0,0 +1,8 @@
+package pool
+
+import "errors"
+
+// ErrUnknownTask is returned by WaitForTask when called with an ID that was
+// never handed out by NextID/AddTask, or whose delivered result has since
+// aged out of the waiter map (see waiterRetention in pool.go).
+var ErrUnknownTask = errors.New("pool: unknown task id")
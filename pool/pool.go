@@ -0,0 +1,175 @@
+// Package pool implements a bounded worker pool for running arbitrary
+// functions asynchronously and collecting their results by task ID.
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// waiterRetention bounds how long a delivered waitEntry is kept in
+// TaskPool.waiters after its result is ready, so a client retrying a
+// timed-out long-poll (see defaultPoolWaitTimeout in poolserver.go) can
+// still observe it, while a delivered task nobody ever polls again doesn't
+// leak for the life of the process. It doesn't bound waiters whose task is
+// never submitted or never admitted (e.g. stuck behind a permanent
+// scheduler collision) — those are allocated by NextID but never reach
+// deliver, so nothing schedules their cleanup.
+const waiterRetention = 60 * time.Second
+
+// WaitBuf is the result delivered to a caller of WaitForTask. Metrics is
+// whatever the submitted function chose to report alongside its result
+// (e.g. a RunMetrics value); the pool itself doesn't interpret it.
+type WaitBuf struct {
+	Value   interface{}
+	Error   error
+	Metrics interface{}
+}
+
+// TaskPool runs submitted functions across a fixed number of worker
+// goroutines and lets callers await a specific task's result.
+type TaskPool struct {
+	maxWorkers int
+	work       chan poolTask
+
+	nextID  atomic.Uint64
+	waiters sync.Map // map[uint64]*waitEntry
+
+	workerStates []atomic.Int32 // one per worker goroutine, see WorkerStates
+
+	wg sync.WaitGroup
+}
+
+type poolTask struct {
+	id uint64
+	fn func() (interface{}, error, interface{})
+}
+
+// waitEntry holds the result for one task ID, delivered by closing done.
+// Closing (rather than sending on a cap-1 channel) lets any number of
+// concurrent or repeated WaitForTask calls for the same ID observe the
+// result, instead of only the first one to receive.
+type waitEntry struct {
+	done   chan struct{}
+	result WaitBuf
+}
+
+// NewTaskPool creates a TaskPool with maxWorkers worker goroutines and a
+// work queue buffered to hold bufferSize pending tasks before AddTask
+// blocks.
+func NewTaskPool(maxWorkers, bufferSize int) *TaskPool {
+	return &TaskPool{
+		maxWorkers:   maxWorkers,
+		work:         make(chan poolTask, bufferSize),
+		workerStates: make([]atomic.Int32, maxWorkers),
+	}
+}
+
+// MaxWorkers returns the number of worker goroutines this pool runs.
+func (p *TaskPool) MaxWorkers() int {
+	return p.maxWorkers
+}
+
+// Start launches the worker goroutines. It must be called once before
+// AddTask is used.
+func (p *TaskPool) Start() {
+	for i := 0; i < p.maxWorkers; i++ {
+		p.wg.Add(1)
+		go p.worker(i)
+	}
+}
+
+// Stop closes the work queue and waits for all in-flight tasks to finish.
+// No further calls to AddTask/SubmitWithID may be made after Stop.
+func (p *TaskPool) Stop() {
+	close(p.work)
+	p.wg.Wait()
+}
+
+func (p *TaskPool) worker(idx int) {
+	defer func() {
+		p.workerStates[idx].Store(int32(WorkerFinished))
+		p.wg.Done()
+	}()
+	for t := range p.work {
+		p.workerStates[idx].Store(int32(WorkerActive))
+		value, err, metrics := t.fn()
+		p.deliver(t.id, WaitBuf{Value: value, Error: err, Metrics: metrics})
+	}
+}
+
+func (p *TaskPool) deliver(id uint64, buf WaitBuf) {
+	v, ok := p.waiters.Load(id)
+	if !ok {
+		return
+	}
+	entry := v.(*waitEntry)
+	entry.result = buf
+	close(entry.done)
+
+	time.AfterFunc(waiterRetention, func() { p.waiters.Delete(id) })
+}
+
+// WorkerState is the lifecycle state of one worker goroutine, as reported
+// by WorkerStates.
+type WorkerState int32
+
+// Worker states, in the order a worker goroutine passes through them.
+const (
+	WorkerStarting WorkerState = iota
+	WorkerActive
+	WorkerFinished
+)
+
+// WorkerStates reports the current state of every worker goroutine,
+// indexed 0..MaxWorkers()-1.
+func (p *TaskPool) WorkerStates() []WorkerState {
+	states := make([]WorkerState, len(p.workerStates))
+	for i := range p.workerStates {
+		states[i] = WorkerState(p.workerStates[i].Load())
+	}
+	return states
+}
+
+// NextID allocates and returns the next pool task ID, registering a waiter
+// for it so WaitForTask can be called (and will block) immediately, even
+// before the task is actually submitted via SubmitWithID. This lets a
+// caller hand the ID to a client before the work is admitted to run.
+func (p *TaskPool) NextID() uint64 {
+	id := p.nextID.Add(1)
+	p.waiters.Store(id, &waitEntry{done: make(chan struct{})})
+	return id
+}
+
+// SubmitWithID queues fn for execution under an ID previously returned by
+// NextID.
+func (p *TaskPool) SubmitWithID(id uint64, fn func() (interface{}, error, interface{})) {
+	p.work <- poolTask{id: id, fn: fn}
+}
+
+// AddTask queues fn for execution by a worker and returns a monotonically
+// increasing task ID that can be passed to WaitForTask. fn's third return
+// value is carried through to WaitBuf.Metrics unexamined.
+func (p *TaskPool) AddTask(fn func() (interface{}, error, interface{})) uint64 {
+	id := p.NextID()
+	p.SubmitWithID(id, fn)
+	return id
+}
+
+// WaitForTask blocks until the task with the given ID has finished and
+// returns its result. It is safe to call WaitForTask more than once, and
+// concurrently, for the same ID (e.g. a client retrying a timed-out
+// long-poll) — every caller observes the same result once it's ready, for
+// as long as the waiter is retained (see waiterRetention); after that, an
+// ID that already delivered its result reads back as ErrUnknownTask like
+// one that was never issued.
+func (p *TaskPool) WaitForTask(id uint64) WaitBuf {
+	v, ok := p.waiters.Load(id)
+	if !ok {
+		return WaitBuf{Error: ErrUnknownTask}
+	}
+	entry := v.(*waitEntry)
+	<-entry.done
+	return entry.result
+}
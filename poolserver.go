@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kaegeen/task/pool"
+)
+
+// taskPool runs task work asynchronously with bounded concurrency. It is
+// started in main and shared by the HTTP handlers below.
+var taskPool = pool.NewTaskPool(4, 64)
+
+// scheduler holds tasks that were submitted for execution until the
+// configured ConcurrencyMode allows them to run, then hands them to
+// taskPool. Mode and the parallelism cap are configurable via the
+// CONCURRENCY_MODE and MAX_PARALLEL_TASKS environment variables; the
+// default mode ("none") keeps the pre-existing run-one-at-a-time behavior,
+// and the default cap matches taskPool's worker count. See scheduler.go.
+var scheduler = newTaskScheduler(concurrencyModeFromEnv(), maxParallelTasksFromEnv(taskPool.MaxWorkers()), taskPool, runTaskWork)
+
+// runTaskWork is the work a scheduled task performs: simulate processing
+// and persist the result, mirroring processTasksConcurrently, with
+// TimeLimitMs/MemoryLimitMB enforced and RunMetrics captured around it.
+func runTaskWork(task Task) (interface{}, error, RunMetrics) {
+	return runWithLimits(task, func() (interface{}, error) {
+		time.Sleep(1 * time.Second)
+		task.Completed = true
+		return store.Update(task)
+	})
+}
+
+// defaultPoolWaitTimeout bounds how long GET /tasks/pool/{poolID} long-polls
+// before returning 504, so a slow task can't hold the connection open
+// forever.
+const defaultPoolWaitTimeout = 25 * time.Second
+
+// runTaskHandler handles POST /tasks/{id}/run: it looks up the task and
+// hands it to the scheduler, which runs it through the pool as soon as the
+// configured ConcurrencyMode allows, and returns the pool task ID to poll
+// via GET /tasks/pool/{poolID}. Use GET /tasks/running and GET /tasks/pending
+// to observe when it actually starts.
+func runTaskHandler(w http.ResponseWriter, r *http.Request, idPart string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	task, ok, err := store.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	poolID := scheduler.Submit(task)
+
+	respondWithJSON(w, http.StatusAccepted, map[string]uint64{"pool_task_id": poolID})
+}
+
+// poolWorkerStatuses reports taskPool's worker states as the WorkerStatus
+// values a heartbeat records, so the heartbeater reflects the pool's actual
+// worker lifecycle instead of a fixed placeholder.
+func poolWorkerStatuses() []WorkerStatus {
+	states := taskPool.WorkerStates()
+	statuses := make([]WorkerStatus, len(states))
+	for i, s := range states {
+		switch s {
+		case pool.WorkerActive:
+			statuses[i] = WorkerActive
+		case pool.WorkerFinished:
+			statuses[i] = WorkerFinished
+		default:
+			statuses[i] = WorkerStarting
+		}
+	}
+	return statuses
+}
+
+// runningTasksHandler handles GET /tasks/running.
+func runningTasksHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, scheduler.Running())
+}
+
+// pendingTasksHandler handles GET /tasks/pending.
+func pendingTasksHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, scheduler.Pending())
+}
+
+// poolResultHandler handles GET /tasks/pool/{poolID}: it blocks on
+// WaitForTask, up to defaultPoolWaitTimeout, and returns the task result
+// once available.
+func poolResultHandler(w http.ResponseWriter, r *http.Request, poolIDPart string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	poolID, err := strconv.ParseUint(poolIDPart, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid pool task ID", http.StatusBadRequest)
+		return
+	}
+
+	resultCh := make(chan pool.WaitBuf, 1)
+	go func() { resultCh <- taskPool.WaitForTask(poolID) }()
+
+	select {
+	case buf := <-resultCh:
+		if buf.Error == pool.ErrUnknownTask {
+			http.Error(w, "Pool task not found", http.StatusNotFound)
+			return
+		}
+		if buf.Error != nil {
+			http.Error(w, buf.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		metrics, _ := buf.Metrics.(RunMetrics)
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"value": buf.Value, "metrics": metrics})
+	case <-time.After(defaultPoolWaitTimeout):
+		http.Error(w, "Timed out waiting for task result", http.StatusGatewayTimeout)
+	}
+}
+
+// metricsHandler handles GET /tasks/{id}/metrics, returning the most recent
+// RunMetrics recorded for that task.
+func metricsHandler(w http.ResponseWriter, r *http.Request, idPart string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	metrics, err := store.ListMetrics(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, metrics)
+}
+
+// tasksPrefixHandler dispatches the dynamic /tasks/... routes that the
+// exact-match handlers registered in main don't cover.
+func tasksPrefixHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/tasks/")
+
+	switch {
+	case strings.HasPrefix(path, "pool/"):
+		poolResultHandler(w, r, strings.TrimPrefix(path, "pool/"))
+	case strings.HasSuffix(path, "/run"):
+		runTaskHandler(w, r, strings.TrimSuffix(path, "/run"))
+	case strings.HasSuffix(path, "/metrics"):
+		metricsHandler(w, r, strings.TrimSuffix(path, "/metrics"))
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"kaegeen/task/pool"
+)
+
+// ConcurrencyMode controls which tasks are allowed to run at the same time.
+type ConcurrencyMode string
+
+const (
+	// ConcurrencyNone runs tasks strictly one at a time.
+	ConcurrencyNone ConcurrencyMode = "none"
+	// ConcurrencyProject allows concurrent tasks as long as no two share a
+	// ProjectID.
+	ConcurrencyProject ConcurrencyMode = "project"
+	// ConcurrencyResource allows concurrent tasks as long as no two have
+	// intersecting Resources.
+	ConcurrencyResource ConcurrencyMode = "resource"
+)
+
+// concurrencyModeFromEnv reads CONCURRENCY_MODE ("none", "project", or
+// "resource"), defaulting to ConcurrencyNone for an unset or unrecognized
+// value.
+func concurrencyModeFromEnv() ConcurrencyMode {
+	switch ConcurrencyMode(os.Getenv("CONCURRENCY_MODE")) {
+	case ConcurrencyProject:
+		return ConcurrencyProject
+	case ConcurrencyResource:
+		return ConcurrencyResource
+	default:
+		return ConcurrencyNone
+	}
+}
+
+// maxParallelTasksFromEnv reads MAX_PARALLEL_TASKS, defaulting to and
+// capping at poolSize: the pool only has poolSize worker goroutines, so a
+// higher cap would let Running() report tasks as "running" that are
+// actually still queued for a free worker.
+func maxParallelTasksFromEnv(poolSize int) int {
+	raw := os.Getenv("MAX_PARALLEL_TASKS")
+	if raw == "" {
+		return poolSize
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("scheduler: invalid MAX_PARALLEL_TASKS %q, using pool size %d", raw, poolSize)
+		return poolSize
+	}
+	if n > poolSize {
+		log.Printf("scheduler: MAX_PARALLEL_TASKS %d exceeds pool size %d, capping at %d", n, poolSize, poolSize)
+		return poolSize
+	}
+	return n
+}
+
+// taskScheduler holds tasks in a pending queue until they can run without
+// colliding with whatever is already running, then hands them to the pool.
+// All scheduling decisions go through tryStart, guarded by a single mutex,
+// so the collision invariants are easy to reason about.
+type taskScheduler struct {
+	mu          sync.Mutex
+	mode        ConcurrencyMode
+	maxParallel int
+	pool        *pool.TaskPool
+	runFunc     func(Task) (interface{}, error, RunMetrics)
+
+	running map[int]Task
+	pending []pendingTask
+
+	// stopped, once true, makes tryStart a no-op. It must be set (via
+	// StopAdmitting) before the underlying pool is stopped, or a task
+	// admitted concurrently with the pool closing its work channel would
+	// panic on a send to a closed channel.
+	stopped bool
+}
+
+// pendingTask pairs a queued task with the pool ID already allocated for
+// it, so the ID handed to the submitter up front is the same one the task
+// actually runs under once admitted.
+type pendingTask struct {
+	task   Task
+	poolID uint64
+}
+
+// newTaskScheduler builds a scheduler that runs admitted tasks through p
+// using runFunc to do the actual work.
+func newTaskScheduler(mode ConcurrencyMode, maxParallel int, p *pool.TaskPool, runFunc func(Task) (interface{}, error, RunMetrics)) *taskScheduler {
+	return &taskScheduler{
+		mode:        mode,
+		maxParallel: maxParallel,
+		pool:        p,
+		runFunc:     runFunc,
+		running:     make(map[int]Task),
+	}
+}
+
+// Submit queues task, attempts to start it (and anything else now eligible)
+// immediately, and returns the pool task ID the caller can pass to
+// pool.TaskPool.WaitForTask (via GET /tasks/pool/{poolID}) to await its
+// result — the ID is allocated up front, so it's valid even if the task
+// ends up waiting behind a collision before it actually runs.
+func (s *taskScheduler) Submit(task Task) uint64 {
+	poolID := s.pool.NextID()
+
+	s.mu.Lock()
+	s.pending = append(s.pending, pendingTask{task: task, poolID: poolID})
+	s.mu.Unlock()
+
+	s.tryStart()
+	return poolID
+}
+
+// tryStart scans the pending queue once, admitting every task that fits
+// under maxParallel and doesn't collide with whatever is already (or about
+// to be) running.
+func (s *taskScheduler) tryStart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+
+	remaining := s.pending[:0:0]
+	for _, p := range s.pending {
+		if len(s.running) >= s.maxParallel || s.collidesLocked(p.task) {
+			remaining = append(remaining, p)
+			continue
+		}
+
+		s.running[p.task.ID] = p.task
+		task := p.task
+		s.pool.SubmitWithID(p.poolID, func() (interface{}, error, interface{}) {
+			result, err, metrics := s.runFunc(task)
+			if serr := store.SaveMetrics(task.ID, metrics); serr != nil {
+				log.Printf("task %d: failed to save metrics: %v", task.ID, serr)
+			}
+			s.finish(task.ID)
+			return result, err, metrics
+		})
+	}
+	s.pending = remaining
+}
+
+// StopAdmitting prevents tryStart from handing any further tasks to the
+// pool. Callers must call this and wait for it to return before stopping
+// the pool itself: because it takes the same mutex tryStart holds while
+// submitting, it can't return while a submission is in flight, and any
+// tryStart call afterward is guaranteed to see stopped and bail out before
+// touching the pool.
+func (s *taskScheduler) StopAdmitting() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+}
+
+// finish marks task as no longer running and gives the next pending tasks a
+// chance to start.
+func (s *taskScheduler) finish(id int) {
+	s.mu.Lock()
+	delete(s.running, id)
+	s.mu.Unlock()
+
+	s.tryStart()
+}
+
+// collidesLocked reports whether t would collide with a currently running
+// task under the configured ConcurrencyMode. Callers must hold s.mu.
+func (s *taskScheduler) collidesLocked(t Task) bool {
+	switch s.mode {
+	case ConcurrencyNone:
+		return len(s.running) > 0
+	case ConcurrencyProject:
+		for _, r := range s.running {
+			if r.ProjectID == t.ProjectID {
+				return true
+			}
+		}
+		return false
+	case ConcurrencyResource:
+		for _, r := range s.running {
+			if resourcesIntersect(r.Resources, t.Resources) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func resourcesIntersect(a, b []string) bool {
+	set := make(map[string]struct{}, len(a))
+	for _, r := range a {
+		set[r] = struct{}{}
+	}
+	for _, r := range b {
+		if _, ok := set[r]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Running returns a snapshot of the currently running tasks.
+func (s *taskScheduler) Running() []Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := make([]Task, 0, len(s.running))
+	for _, t := range s.running {
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+// Pending returns a snapshot of the tasks still waiting for a free,
+// non-colliding slot.
+func (s *taskScheduler) Pending() []Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := make([]Task, len(s.pending))
+	for i, p := range s.pending {
+		tasks[i] = p.task
+	}
+	return tasks
+}
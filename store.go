@@ -0,0 +1,641 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store is the persistence backend for tasks. Implementations must be safe
+// for concurrent use by multiple task-server instances.
+type Store interface {
+	Create(task Task) (Task, error)
+	Get(id int) (Task, bool, error)
+	List() ([]Task, error)
+	Update(task Task) (Task, error)
+	Delete(id int) error
+
+	// SaveHeartbeat records the latest identity/status snapshot for a
+	// running server process so it can be enumerated by other instances.
+	SaveHeartbeat(info ProcessInfo) error
+	ListHeartbeats() ([]ProcessInfo, error)
+
+	// SaveMetrics appends a RunMetrics entry for a task, trimming to the
+	// most recent maxMetricsPerTask. ListMetrics returns them, newest last.
+	SaveMetrics(taskID int, m RunMetrics) error
+	ListMetrics(taskID int) ([]RunMetrics, error)
+}
+
+// ErrNotFound is returned by Store implementations when a task id is unknown.
+var ErrNotFound = fmt.Errorf("task not found")
+
+// WorkerStatus describes the lifecycle state of a single worker slot as
+// reported in a heartbeat.
+type WorkerStatus string
+
+const (
+	WorkerStarting WorkerStatus = "starting"
+	WorkerActive   WorkerStatus = "active"
+	WorkerFinished WorkerStatus = "finished"
+)
+
+// ProcessInfo identifies one task-server instance and its current workers,
+// written to the store periodically so a shared backend can be used to
+// monitor every server sharing it.
+type ProcessInfo struct {
+	Host        string         `json:"host"`
+	PID         int            `json:"pid"`
+	ServerID    string         `json:"server_id"`
+	Concurrency int            `json:"concurrency"`
+	StartedAt   time.Time      `json:"started_at"`
+	Workers     []WorkerStatus `json:"workers"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// MemoryStore is an in-memory Store backed by a map, suitable for a single
+// instance or for tests. The zero value is not usable; use NewMemoryStore.
+type MemoryStore struct {
+	mu         sync.Mutex
+	tasks      map[int]Task
+	nextID     atomic.Int64
+	heartbeats map[string]ProcessInfo
+	metrics    map[int][]RunMetrics
+}
+
+// NewMemoryStore returns an empty MemoryStore ready for use.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		tasks:      make(map[int]Task),
+		heartbeats: make(map[string]ProcessInfo),
+		metrics:    make(map[int][]RunMetrics),
+	}
+	s.nextID.Store(0)
+	return s
+}
+
+func (s *MemoryStore) Create(task Task) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task.ID = int(s.nextID.Add(1))
+	task.CreatedAt = time.Now()
+	s.tasks[task.ID] = task
+	return task, nil
+}
+
+func (s *MemoryStore) Get(id int) (Task, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	return task, ok, nil
+}
+
+func (s *MemoryStore) List() ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := make([]Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *MemoryStore) Update(task Task) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.tasks[task.ID]
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	existing.Title = task.Title
+	existing.Completed = task.Completed
+	s.tasks[task.ID] = existing
+	return existing, nil
+}
+
+func (s *MemoryStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.tasks, id)
+	return nil
+}
+
+func (s *MemoryStore) SaveHeartbeat(info ProcessInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.heartbeats[info.ServerID] = info
+	return nil
+}
+
+func (s *MemoryStore) ListHeartbeats() ([]ProcessInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]ProcessInfo, 0, len(s.heartbeats))
+	for _, info := range s.heartbeats {
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *MemoryStore) SaveMetrics(taskID int, m RunMetrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := append(s.metrics[taskID], m)
+	if len(history) > maxMetricsPerTask {
+		history = history[len(history)-maxMetricsPerTask:]
+	}
+	s.metrics[taskID] = history
+	return nil
+}
+
+func (s *MemoryStore) ListMetrics(taskID int) ([]RunMetrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.metrics[taskID]
+	out := make([]RunMetrics, len(history))
+	copy(out, history)
+	return out, nil
+}
+
+// RedisStore persists tasks and heartbeats in Redis, allowing several
+// task-server instances to share one backend. It speaks just enough of the
+// RESP protocol to issue the handful of commands it needs, so it has no
+// dependency beyond the standard library.
+type RedisStore struct {
+	addr string
+
+	mu   sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// NewRedisStore dials addr (host:port) and returns a Store backed by it.
+func NewRedisStore(addr string) (*RedisStore, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: dial %s: %w", addr, err)
+	}
+	return &RedisStore{
+		addr: addr,
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}, nil
+}
+
+func (s *RedisStore) do(args ...string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(s.rw, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(s.rw, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := s.rw.Flush(); err != nil {
+		return "", err
+	}
+
+	line, err := s.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	switch line[0] {
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '+', ':':
+		return line[1 : len(line)-2], nil
+	case '$':
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		if n < 0 {
+			return "", nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := fmtReadFull(s.rw, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	default:
+		return "", fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// doArray issues args and reads back a RESP array reply (as produced by
+// HGETALL/LRANGE), returning its elements as strings. Nil bulk strings
+// (RESP's representation of a missing value) come back as "".
+func (s *RedisStore) doArray(args ...string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(s.rw, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(s.rw, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := s.rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	line, err := s.rw.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if line[0] == '-' {
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	}
+	if line[0] != '*' {
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+	var n int
+	fmt.Sscanf(line[1:], "%d", &n)
+	if n < 0 {
+		return nil, nil
+	}
+
+	elems := make([]string, n)
+	for i := 0; i < n; i++ {
+		elemLine, err := s.rw.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if elemLine[0] != '$' {
+			return nil, fmt.Errorf("redis: unexpected array element %q", elemLine)
+		}
+		var elemLen int
+		fmt.Sscanf(elemLine[1:], "%d", &elemLen)
+		if elemLen < 0 {
+			continue
+		}
+		buf := make([]byte, elemLen+2)
+		if _, err := fmtReadFull(s.rw, buf); err != nil {
+			return nil, err
+		}
+		elems[i] = string(buf[:elemLen])
+	}
+	return elems, nil
+}
+
+func fmtReadFull(rw *bufio.ReadWriter, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := rw.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (s *RedisStore) Create(task Task) (Task, error) {
+	idStr, err := s.do("INCR", "task:next_id")
+	if err != nil {
+		return Task{}, err
+	}
+	fmt.Sscanf(idStr, "%d", &task.ID)
+	task.CreatedAt = time.Now()
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return Task{}, err
+	}
+	if _, err := s.do("HSET", "tasks", fmt.Sprintf("%d", task.ID), string(data)); err != nil {
+		return Task{}, err
+	}
+	return task, nil
+}
+
+func (s *RedisStore) Get(id int) (Task, bool, error) {
+	data, err := s.do("HGET", "tasks", fmt.Sprintf("%d", id))
+	if err != nil {
+		return Task{}, false, err
+	}
+	if data == "" {
+		return Task{}, false, nil
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		return Task{}, false, err
+	}
+	return task, true, nil
+}
+
+func (s *RedisStore) List() ([]Task, error) {
+	fields, err := s.doArray("HGETALL", "tasks")
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]Task, 0, len(fields)/2)
+	for i := 1; i < len(fields); i += 2 {
+		var task Task
+		if err := json.Unmarshal([]byte(fields[i]), &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *RedisStore) Update(task Task) (Task, error) {
+	existing, ok, err := s.Get(task.ID)
+	if err != nil {
+		return Task{}, err
+	}
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	existing.Title = task.Title
+	existing.Completed = task.Completed
+
+	data, err := json.Marshal(existing)
+	if err != nil {
+		return Task{}, err
+	}
+	if _, err := s.do("HSET", "tasks", fmt.Sprintf("%d", existing.ID), string(data)); err != nil {
+		return Task{}, err
+	}
+	return existing, nil
+}
+
+func (s *RedisStore) Delete(id int) error {
+	n, err := s.do("HDEL", "tasks", fmt.Sprintf("%d", id))
+	if err != nil {
+		return err
+	}
+	if n == "0" {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *RedisStore) SaveHeartbeat(info ProcessInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.do("HSET", "heartbeats", info.ServerID, string(data))
+	return err
+}
+
+func (s *RedisStore) ListHeartbeats() ([]ProcessInfo, error) {
+	fields, err := s.doArray("HGETALL", "heartbeats")
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ProcessInfo, 0, len(fields)/2)
+	for i := 1; i < len(fields); i += 2 {
+		var info ProcessInfo
+		if err := json.Unmarshal([]byte(fields[i]), &info); err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *RedisStore) SaveMetrics(taskID int, m RunMetrics) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("metrics:%d", taskID)
+	if _, err := s.do("RPUSH", key, string(data)); err != nil {
+		return err
+	}
+	_, err = s.do("LTRIM", key, fmt.Sprintf("%d", -maxMetricsPerTask), "-1")
+	return err
+}
+
+func (s *RedisStore) ListMetrics(taskID int) ([]RunMetrics, error) {
+	entries, err := s.doArray("LRANGE", fmt.Sprintf("metrics:%d", taskID), "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]RunMetrics, len(entries))
+	for i, e := range entries {
+		if err := json.Unmarshal([]byte(e), &metrics[i]); err != nil {
+			return nil, err
+		}
+	}
+	return metrics, nil
+}
+
+// SQLStore persists tasks and heartbeats through database/sql, so it works
+// with any driver the caller registers (Postgres, MySQL, SQLite, ...). The
+// caller is responsible for importing the driver package and creating the
+// `tasks` and `heartbeats` tables; see schema.sql.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore wraps an already-open *sql.DB.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Create(task Task) (Task, error) {
+	task.CreatedAt = time.Now()
+	resources, err := json.Marshal(task.Resources)
+	if err != nil {
+		return Task{}, err
+	}
+	res, err := s.db.Exec(
+		`INSERT INTO tasks (title, completed, created_at, project_id, resources, time_limit_ms, memory_limit_mb)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		task.Title, task.Completed, task.CreatedAt, task.ProjectID, string(resources), task.TimeLimitMs, task.MemoryLimitMB,
+	)
+	if err != nil {
+		return Task{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Task{}, err
+	}
+	task.ID = int(id)
+	return task, nil
+}
+
+func (s *SQLStore) Get(id int) (Task, bool, error) {
+	var task Task
+	var resources string
+	row := s.db.QueryRow(
+		`SELECT id, title, completed, created_at, project_id, resources, time_limit_ms, memory_limit_mb
+		 FROM tasks WHERE id = ?`, id,
+	)
+	if err := row.Scan(&task.ID, &task.Title, &task.Completed, &task.CreatedAt, &task.ProjectID, &resources, &task.TimeLimitMs, &task.MemoryLimitMB); err != nil {
+		if err == sql.ErrNoRows {
+			return Task{}, false, nil
+		}
+		return Task{}, false, err
+	}
+	if err := json.Unmarshal([]byte(resources), &task.Resources); err != nil {
+		return Task{}, false, err
+	}
+	return task, true, nil
+}
+
+func (s *SQLStore) List() ([]Task, error) {
+	rows, err := s.db.Query(
+		`SELECT id, title, completed, created_at, project_id, resources, time_limit_ms, memory_limit_mb FROM tasks`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []Task
+	for rows.Next() {
+		var task Task
+		var resources string
+		if err := rows.Scan(&task.ID, &task.Title, &task.Completed, &task.CreatedAt, &task.ProjectID, &resources, &task.TimeLimitMs, &task.MemoryLimitMB); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(resources), &task.Resources); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// Update only mutates Title/Completed, same as MemoryStore and RedisStore;
+// ProjectID/Resources/TimeLimitMs/MemoryLimitMB are set at creation and left
+// untouched here.
+func (s *SQLStore) Update(task Task) (Task, error) {
+	res, err := s.db.Exec(`UPDATE tasks SET title = ?, completed = ? WHERE id = ?`, task.Title, task.Completed, task.ID)
+	if err != nil {
+		return Task{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Task{}, err
+	}
+	if n == 0 {
+		return Task{}, ErrNotFound
+	}
+	return s.mustGet(task.ID)
+}
+
+func (s *SQLStore) mustGet(id int) (Task, error) {
+	task, ok, err := s.Get(id)
+	if err != nil {
+		return Task{}, err
+	}
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	return task, nil
+}
+
+func (s *SQLStore) Delete(id int) error {
+	res, err := s.db.Exec(`DELETE FROM tasks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) SaveHeartbeat(info ProcessInfo) error {
+	_, err := s.db.Exec(
+		`INSERT INTO heartbeats (server_id, host, pid, concurrency, started_at, updated_at, payload)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (server_id) DO UPDATE SET updated_at = excluded.updated_at, payload = excluded.payload`,
+		info.ServerID, info.Host, info.PID, info.Concurrency, info.StartedAt, info.UpdatedAt, mustMarshal(info),
+	)
+	return err
+}
+
+func (s *SQLStore) ListHeartbeats() ([]ProcessInfo, error) {
+	rows, err := s.db.Query(`SELECT payload FROM heartbeats`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infos []ProcessInfo
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var info ProcessInfo
+		if err := json.Unmarshal([]byte(payload), &info); err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+func (s *SQLStore) SaveMetrics(taskID int, m RunMetrics) error {
+	_, err := s.db.Exec(
+		`INSERT INTO task_metrics (task_id, wall_time_ms, cpu_time_ms, max_rss_bytes, exit_status, recorded_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		taskID, m.WallTimeMs, m.CPUTimeMs, m.MaxRSSBytes, m.ExitStatus, time.Now(),
+	)
+	return err
+}
+
+// ListMetrics returns the most recent maxMetricsPerTask entries, oldest
+// first ("newest last", per the Store interface doc), matching
+// MemoryStore's append order and RedisStore's LRANGE over RPUSH.
+func (s *SQLStore) ListMetrics(taskID int) ([]RunMetrics, error) {
+	rows, err := s.db.Query(
+		`SELECT wall_time_ms, cpu_time_ms, max_rss_bytes, exit_status FROM task_metrics
+		 WHERE task_id = ? ORDER BY id DESC LIMIT ?`,
+		taskID, maxMetricsPerTask,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []RunMetrics
+	for rows.Next() {
+		var m RunMetrics
+		if err := rows.Scan(&m.WallTimeMs, &m.CPUTimeMs, &m.MaxRSSBytes, &m.ExitStatus); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(metrics)-1; i < j; i, j = i+1, j-1 {
+		metrics[i], metrics[j] = metrics[j], metrics[i]
+	}
+	return metrics, nil
+}
+
+func mustMarshal(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
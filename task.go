@@ -1,29 +1,65 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
+// shutdownGracePeriod bounds how long main waits for in-flight work to
+// drain after a shutdown signal before giving up and exiting anyway.
+const shutdownGracePeriod = 15 * time.Second
+
 // Task represents a task object
 type Task struct {
 	ID        int       `json:"id"`
 	Title     string    `json:"title"`
 	Completed bool      `json:"completed"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// ProjectID and Resources are consulted by the scheduler when
+	// ConcurrencyMode is "project" or "resource"; see scheduler.go.
+	ProjectID string   `json:"project_id,omitempty"`
+	Resources []string `json:"resources,omitempty"`
+
+	// TimeLimitMs and MemoryLimitMB, if set, are enforced by runWithLimits
+	// (see metrics.go) while the task executes through the pool.
+	TimeLimitMs   int64 `json:"time_limit_ms,omitempty"`
+	MemoryLimitMB int64 `json:"memory_limit_mb,omitempty"`
 }
 
-// In-memory "database"
-var taskDB = struct {
-	sync.Mutex
-	tasks map[int]Task
-}{tasks: make(map[int]Task)}
+// store is the persistence backend for tasks, chosen by initStore from the
+// STORE_BACKEND environment variable. It defaults to an in-memory store.
+var store Store = initStore()
 
-var taskIDCounter = 1
+// initStore selects a Store implementation based on the STORE_BACKEND
+// environment variable ("memory", the default, or "redis", using REDIS_ADDR
+// to dial). SQLStore isn't wired up here since it needs a driver import the
+// caller must choose; embedders that want it can set store directly before
+// main runs.
+func initStore() Store {
+	switch os.Getenv("STORE_BACKEND") {
+	case "redis":
+		addr := os.Getenv("REDIS_ADDR")
+		if addr == "" {
+			addr = "localhost:6379"
+		}
+		redisStore, err := NewRedisStore(addr)
+		if err != nil {
+			log.Fatalf("store: %v", err)
+		}
+		return redisStore
+	default:
+		return NewMemoryStore()
+	}
+}
 
 // Function to respond with JSON
 func respondWithJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -36,12 +72,10 @@ func respondWithJSON(w http.ResponseWriter, status int, data interface{}) {
 
 // Handler to list all tasks
 func getTasksHandler(w http.ResponseWriter, r *http.Request) {
-	taskDB.Lock()
-	defer taskDB.Unlock()
-
-	var tasks []Task
-	for _, task := range taskDB.tasks {
-		tasks = append(tasks, task)
+	tasks, err := store.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, tasks)
@@ -55,13 +89,11 @@ func createTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	taskDB.Lock()
-	defer taskDB.Unlock()
-
-	newTask.ID = taskIDCounter
-	newTask.CreatedAt = time.Now()
-	taskDB.tasks[taskIDCounter] = newTask
-	taskIDCounter++
+	newTask, err := store.Create(newTask)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	respondWithJSON(w, http.StatusCreated, newTask)
 }
@@ -74,20 +106,15 @@ func updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	taskDB.Lock()
-	defer taskDB.Unlock()
-
-	// Check if the task exists
-	task, exists := taskDB.tasks[updatedTask.ID]
-	if !exists {
+	task, err := store.Update(updatedTask)
+	if err == ErrNotFound {
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
 	}
-
-	// Update task fields
-	task.Title = updatedTask.Title
-	task.Completed = updatedTask.Completed
-	taskDB.tasks[updatedTask.ID] = task
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, task)
 }
@@ -100,38 +127,45 @@ func deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	taskDB.Lock()
-	defer taskDB.Unlock()
-
-	// Convert taskID to integer
-	id, err := fmt.Sscanf(taskID, "%d")
+	id, err := strconv.Atoi(taskID)
 	if err != nil {
 		http.Error(w, "Invalid task ID", http.StatusBadRequest)
 		return
 	}
 
-	// Delete the task from the map
-	_, exists := taskDB.tasks[id]
-	if !exists {
+	if err := store.Delete(id); err == ErrNotFound {
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	delete(taskDB.tasks, id)
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Concurrent task processing
-func processTasksConcurrently(tasks []Task, ch chan Task) {
+// Concurrent task processing. Each task runs in its own goroutine; results
+// are sent back on ch, which is closed once every task has reported (or
+// done is closed, whichever comes first) so a consumer can safely range
+// over it without leaking a send on a channel nobody is reading from after
+// shutdown.
+func processTasksConcurrently(tasks []Task, ch chan<- Task, done <-chan struct{}) {
+	var wg sync.WaitGroup
+	wg.Add(len(tasks))
 	for _, task := range tasks {
 		// Simulating some processing time
 		go func(task Task) {
+			defer wg.Done()
 			time.Sleep(1 * time.Second)
 			task.Completed = true
-			ch <- task // Send back processed task to channel
+			select {
+			case ch <- task: // Send back processed task to channel
+			case <-done:
+			}
 		}(task)
 	}
+	wg.Wait()
+	close(ch)
 }
 
 func main() {
@@ -140,29 +174,88 @@ func main() {
 	http.HandleFunc("/tasks/create", createTaskHandler)
 	http.HandleFunc("/tasks/update", updateTaskHandler)
 	http.HandleFunc("/tasks/delete", deleteTaskHandler)
+	http.HandleFunc("/tasks/running", runningTasksHandler)
+	http.HandleFunc("/tasks/pending", pendingTasksHandler)
+	http.HandleFunc("/tasks/", tasksPrefixHandler)
+
+	// Bounded worker pool for async task execution.
+	taskPool.Start()
 
-	// Concurrent task processing (mocked)
-	tasks := []Task{
-		{ID: 1, Title: "Task 1", Completed: false, CreatedAt: time.Now()},
-		{ID: 2, Title: "Task 2", Completed: false, CreatedAt: time.Now()},
-		{ID: 3, Title: "Task 3", Completed: false, CreatedAt: time.Now()},
+	// done signals every background goroutine below to stop; it is closed
+	// once a shutdown signal is received. wg tracks them so main can wait
+	// for them to actually finish before exiting.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Heartbeat this instance's identity so it can be enumerated alongside
+	// any other task-server sharing the same store.
+	hb := newHeartbeater(store, taskPool.MaxWorkers(), 10*time.Second)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		hb.run(done, poolWorkerStatuses)
+	}()
+
+	// Concurrent task processing (mocked). Seed through store.Create so
+	// these tasks actually exist before processTasksConcurrently's result
+	// goroutine tries to store.Update them.
+	var tasks []Task
+	for _, title := range []string{"Task 1", "Task 2", "Task 3"} {
+		task, err := store.Create(Task{Title: title})
+		if err != nil {
+			log.Fatalf("seed task %q: %v", title, err)
+		}
+		tasks = append(tasks, task)
 	}
 
 	// Channel for task results
 	ch := make(chan Task)
-	go processTasksConcurrently(tasks, ch)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		processTasksConcurrently(tasks, ch, done)
+	}()
 
 	// Handling concurrent task results
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for task := range ch {
-			taskDB.Lock()
-			taskDB.tasks[task.ID] = task
-			taskDB.Unlock()
+			if _, err := store.Update(task); err != nil {
+				log.Printf("Task %d: failed to persist result: %v", task.ID, err)
+				continue
+			}
 			log.Printf("Task %d processed: %s", task.ID, task.Title)
 		}
 	}()
 
 	// Start the server
-	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	srv := &http.Server{Addr: ":8080"}
+	go func() {
+		log.Println("Server started on :8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	<-sigCh
+	log.Println("shutdown signal received, draining in-flight work")
+
+	close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+
+	// Stop the scheduler from admitting new work before stopping the pool,
+	// otherwise a task the scheduler is in the middle of admitting could
+	// send on the pool's just-closed work channel and panic.
+	scheduler.StopAdmitting()
+	taskPool.Stop()
+	wg.Wait()
+	log.Println("shutdown complete")
 }